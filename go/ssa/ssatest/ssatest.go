@@ -0,0 +1,125 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ssatest provides assertions over SSA output for use in tests,
+// following the "// want ..." convention used by the go/types check
+// harness: directives are written as comments attached to a source line
+// and are resolved against the built SSA to decide whether the test
+// passes.
+package ssatest
+
+import (
+	"go/ast"
+	"go/token"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// directiveRE matches a "want" or "nowant" annotation, e.g.:
+//
+//	// want ssa:"t0 = \*x"
+//	// nowant ssa:"panic"
+var directiveRE = regexp.MustCompile(`want ssa:"((?:[^"\\]|\\.)*)"|nowant ssa:"((?:[^"\\]|\\.)*)"`)
+
+// CheckAnnotations scans the comments of file for "// want ssa:..." and
+// "// nowant ssa:..." directives attached to a source line, and asserts
+// that the SSA instructions built from pkg whose position falls on that
+// line do (or, for nowant, do not) have a disassembly form matching the
+// given regular expression. The disassembly form of a value-producing
+// instruction is "name = String()" (e.g. "t0 = *x"), mirroring the
+// register prefix ssa.WriteFunction prints; other instructions (Return,
+// Jump, If, ...) match their bare String().
+//
+// Several want/nowant comments may be attached to the same line. A test
+// fails via t.Errorf for every directive that is not satisfied.
+func CheckAnnotations(t testing.TB, pkg *ssa.Package, file *ast.File) {
+	t.Helper()
+
+	fset := pkg.Prog.Fset
+	instrs := instructionsByPosition(fset, pkg)
+
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			for _, m := range directiveRE.FindAllStringSubmatch(c.Text, -1) {
+				want, nowant := m[1], m[2]
+				pattern := want
+				negate := false
+				if nowant != "" {
+					pattern = nowant
+					negate = true
+				}
+				pattern = strings.ReplaceAll(pattern, `\"`, `"`)
+
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					t.Errorf("%s: invalid regexp %q: %v", fset.Position(c.Pos()), pattern, err)
+					continue
+				}
+
+				pos := fset.Position(c.Pos())
+				key := token.Position{Filename: pos.Filename, Line: pos.Line}
+				matched := anyMatch(instrs[key], re)
+
+				switch {
+				case !negate && !matched:
+					t.Errorf("%s: no SSA instruction on this line matches %q", pos, pattern)
+				case negate && matched:
+					t.Errorf("%s: an SSA instruction on this line unexpectedly matches %q", pos, pattern)
+				}
+			}
+		}
+	}
+}
+
+func anyMatch(instrs []ssa.Instruction, re *regexp.Regexp) bool {
+	for _, instr := range instrs {
+		if re.MatchString(disassemble(instr)) {
+			return true
+		}
+	}
+	return false
+}
+
+// disassemble returns the text a want/nowant pattern is matched against:
+// "name = String()" for a named Value (the same register prefix
+// ssa.WriteFunction prints), or the bare String() for any other
+// instruction (Return, Jump, If, Store, ...).
+func disassemble(instr ssa.Instruction) string {
+	if v, ok := instr.(ssa.Value); ok {
+		if name := v.Name(); name != "" {
+			return name + " = " + instr.String()
+		}
+	}
+	return instr.String()
+}
+
+// instructionsByPosition walks every function in pkg's program once,
+// including methods and anonymous functions (neither of which appear
+// directly in pkg.Members), and indexes their instructions by source line,
+// discarding column and offset so that comments anywhere on the line can
+// find them.
+func instructionsByPosition(fset *token.FileSet, pkg *ssa.Package) map[token.Position][]ssa.Instruction {
+	byPos := make(map[token.Position][]ssa.Instruction)
+
+	for fn := range ssautil.AllFunctions(pkg.Prog) {
+		if fn.Pkg != pkg {
+			continue
+		}
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				if !instr.Pos().IsValid() {
+					continue
+				}
+				pos := fset.Position(instr.Pos())
+				key := token.Position{Filename: pos.Filename, Line: pos.Line}
+				byPos[key] = append(byPos[key], instr)
+			}
+		}
+	}
+	return byPos
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssatest
+
+import (
+	"fmt"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+	"golang.org/x/tools/internal/testenv"
+)
+
+// buildPackage loads and builds content as package p, returning its SSA
+// package and the parsed file so CheckAnnotations can be exercised against
+// them directly.
+func buildPackage(t *testing.T, content string) (*ssa.Package, *ast.File) {
+	t.Helper()
+	testenv.NeedsGoBuild(t)
+
+	dir := t.TempDir()
+	overlay := map[string][]byte{
+		filepath.Join(dir, "go.mod"): fmt.Appendf(nil, "module p\ngo 1.%d", testenv.Go1Point()),
+		filepath.Join(dir, "p.go"):   []byte(content),
+	}
+
+	cfg := &packages.Config{
+		Dir:     dir,
+		Mode:    packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedDeps | packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedCompiledGoFiles | packages.NeedTypes,
+		Overlay: overlay,
+		Env:     append(os.Environ(), "GO111MODULE=on", "GOPATH=", "GOWORK=off", "GOPROXY=off"),
+	}
+	pkgs, err := packages.Load(cfg, "p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatal("there were errors")
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("got %d packages, want 1", len(pkgs))
+	}
+	pkg := pkgs[0]
+	if len(pkg.Syntax) != 1 {
+		t.Fatalf("got %d files, want 1", len(pkg.Syntax))
+	}
+
+	prog, _ := ssautil.Packages(pkgs, ssa.SanityCheckFunctions)
+	prog.Build()
+
+	ssaPkg := prog.Package(pkg.Types)
+	if ssaPkg == nil {
+		t.Fatalf("failed to find ssa package for %q", pkg.Types)
+	}
+	return ssaPkg, pkg.Syntax[0]
+}
+
+// TestCheckAnnotationsMethod exercises a directive on a line inside a
+// method body, which is not reachable from pkg.Members directly and
+// previously caused instructionsByPosition to miss it entirely.
+func TestCheckAnnotationsMethod(t *testing.T) {
+	const content = `package p
+
+type T struct{}
+
+func (T) M() int {
+	return 1 // want ssa:"return 1:int"
+}
+`
+	pkg, file := buildPackage(t, content)
+	CheckAnnotations(t, pkg, file)
+}
+
+// TestCheckAnnotationsMultiplePerLine exercises two want directives on the
+// same source line, which previously only the first of was checked.
+func TestCheckAnnotationsMultiplePerLine(t *testing.T) {
+	const content = `package p
+
+func F(x, y int) int {
+	return x + y // want ssa:"t0 = x \+ y" want ssa:"return t0"
+}
+`
+	pkg, file := buildPackage(t, content)
+	CheckAnnotations(t, pkg, file)
+}
@@ -7,12 +7,15 @@
 package ssa_test
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"testing/fstest"
 
@@ -44,6 +47,31 @@ func overlayFS(overlay map[string][]byte) fstest.MapFS {
 	return fs
 }
 
+// fsToOverlay reads every file in fsys into an overlay map keyed by its
+// path within fsys, so that txtar-backed (or any fs.FS-backed) test data
+// can be fed to loadPackagesOverlay.
+func fsToOverlay(fsys fs.FS) map[string][]byte {
+	overlay := make(map[string][]byte)
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+		overlay[path] = data
+		return nil
+	})
+	if err != nil {
+		panic(err) // can't happen: fsys is in-memory or already validated
+	}
+	return overlay
+}
+
 // openTxtar opens a txtar file as a filesystem.
 func openTxtar(t testing.TB, file string) fs.FS {
 	// TODO(taking): Move to testfiles?
@@ -100,6 +128,65 @@ func loadPackages(t testing.TB, src fs.FS, patterns ...string) []*packages.Packa
 	return pkgs
 }
 
+// loadPackagesOverlay loads packages matching the given patterns using the
+// provided overlay of file contents, keyed by path relative to the module
+// root, instead of copying them into a temporary directory first.
+//
+// This avoids the filesystem round-trip loadPackages performs via
+// testfiles.CopyToTmp. The overlay paths are rooted at a fresh t.TempDir()
+// on every call, so file paths differ from one call to the next.
+func loadPackagesOverlay(t testing.TB, overlay map[string][]byte, patterns ...string) []*packages.Package {
+	t.Helper()
+	_, pkgs := loadPackagesOverlayContext(t, overlay, nil, nil, patterns...)
+	return pkgs
+}
+
+// loadPackagesOverlayContext is loadPackagesOverlay with an overridable
+// build context: extraEnv is appended to the environment (e.g. to set GOOS
+// and GOARCH) and buildFlags is passed through to packages.Config.BuildFlags
+// (e.g. "-tags=...").
+func loadPackagesOverlayContext(t testing.TB, overlay map[string][]byte, extraEnv, buildFlags []string, patterns ...string) (dir string, pkgs []*packages.Package) {
+	t.Helper()
+	testenv.NeedsGoBuild(t) // for go/packages
+
+	dir = t.TempDir()
+
+	abs := make(map[string][]byte, len(overlay))
+	for name, data := range overlay {
+		abs[filepath.Join(dir, name)] = data
+	}
+
+	env := append(os.Environ(),
+		"GO111MODULE=on",
+		"GOPATH=",
+		"GOWORK=off",
+		"GOPROXY=off")
+	env = append(env, extraEnv...)
+
+	cfg := &packages.Config{
+		Dir: dir,
+		Mode: packages.NeedSyntax |
+			packages.NeedTypesInfo |
+			packages.NeedDeps |
+			packages.NeedName |
+			packages.NeedFiles |
+			packages.NeedImports |
+			packages.NeedCompiledGoFiles |
+			packages.NeedTypes,
+		Overlay:    abs,
+		Env:        env,
+		BuildFlags: buildFlags,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatal("there were errors")
+	}
+	return dir, pkgs
+}
+
 // buildContent builds the content of a go file into:
 // * a module with the same name as the package at the current go version,
 // * loads the package (parses and types checks),
@@ -108,11 +195,11 @@ func loadPackages(t testing.TB, src fs.FS, patterns ...string) []*packages.Packa
 func buildContent(t testing.TB, content string, mode ssa.BuilderMode) (*ssa.Package, *ast.File) {
 	name := parsePackageClause(t, content)
 
-	fs := overlayFS(map[string][]byte{
+	overlay := map[string][]byte{
 		"go.mod":   goMod(name, -1),
 		"input.go": []byte(content),
-	})
-	pkgs := loadPackages(t, fs, name)
+	}
+	pkgs := loadPackagesOverlay(t, overlay, name)
 	if len(pkgs) != 1 {
 		t.Fatalf("Expected to load 1 package from pattern %q. got %d", name, len(pkgs))
 	}
@@ -134,6 +221,133 @@ func buildContent(t testing.TB, content string, mode ssa.BuilderMode) (*ssa.Pack
 	return p, file
 }
 
+// buildTarget is one entry of a build matrix: a GOOS/GOARCH pair plus any
+// extra build tags to set when loading and building a package.
+type buildTarget struct {
+	GOOS, GOARCH string
+	Tags         []string
+}
+
+// buildKey identifies the ssa.Package built for a buildTarget in the map
+// returned by buildContentMatrix. Tags is included (as its comma-joined
+// form, since a slice can't be a map key) so that two targets sharing a
+// GOOS/GOARCH but differing only in build tags don't collide.
+type buildKey struct {
+	GOOS, GOARCH, Tags string
+}
+
+// newBuildKey derives a buildKey from a buildTarget.
+func newBuildKey(target buildTarget) buildKey {
+	return buildKey{target.GOOS, target.GOARCH, strings.Join(target.Tags, ",")}
+}
+
+// buildContentMatrix is buildContent run once per entry of targets, varying
+// GOOS, GOARCH and build tags, so that tests can assert how SSA lowering
+// differs across build contexts (e.g. runtime.GOOS constant folding, or
+// //go:build-gated declarations) without a separate test binary per
+// platform.
+func buildContentMatrix(t testing.TB, content string, mode ssa.BuilderMode, targets []buildTarget) map[buildKey]*ssa.Package {
+	t.Helper()
+	name := parsePackageClause(t, content)
+
+	result := make(map[buildKey]*ssa.Package, len(targets))
+	for _, target := range targets {
+		overlay := map[string][]byte{
+			"go.mod":   goMod(name, -1),
+			"input.go": []byte(content),
+		}
+		env := []string{"GOOS=" + target.GOOS, "GOARCH=" + target.GOARCH}
+		var buildFlags []string
+		if len(target.Tags) > 0 {
+			buildFlags = []string{"-tags=" + strings.Join(target.Tags, ",")}
+		}
+
+		_, pkgs := loadPackagesOverlayContext(t, overlay, env, buildFlags, name)
+		if len(pkgs) != 1 {
+			t.Fatalf("Expected to load 1 package from pattern %q for %s/%s. got %d", name, target.GOOS, target.GOARCH, len(pkgs))
+		}
+		pkg := pkgs[0]
+
+		prog, _ := ssautil.Packages(pkgs, mode)
+		p := prog.Package(pkg.Types)
+		if p == nil {
+			t.Fatalf("Failed to find ssa package for %q on %s/%s", pkg.Types, target.GOOS, target.GOARCH)
+		}
+		prog.Build()
+
+		result[newBuildKey(target)] = p
+	}
+	return result
+}
+
+// buildTxtar builds the Go files in a txtar archive, which may span multiple
+// files and packages, into an SSA program. archive is either the raw text of
+// a txtar archive (string) or an already-opened archive (fs.FS, e.g. from
+// openTxtar). If the archive has no go.mod, one is synthesized via goMod
+// using the name of its outermost directory.
+//
+// It returns the built program, every loaded SSA package, and the parsed
+// files of the archive keyed by their slash-separated path within it (e.g.
+// "a/main.go"), so that files with the same basename in different packages
+// don't collide.
+func buildTxtar(t testing.TB, archive any, mode ssa.BuilderMode) (*ssa.Program, []*ssa.Package, map[string]*ast.File) {
+	t.Helper()
+
+	var fsys fs.FS
+	switch a := archive.(type) {
+	case string:
+		ar := txtar.Parse([]byte(a))
+		f, err := txtar.FS(ar)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsys = f
+	case fs.FS:
+		fsys = a
+	default:
+		t.Fatalf("buildTxtar: archive must be a string or fs.FS, got %T", archive)
+	}
+
+	overlay := fsToOverlay(fsys)
+	if _, ok := overlay["go.mod"]; !ok {
+		overlay["go.mod"] = goMod(outermostDir(fsys), -1)
+	}
+
+	dir, pkgs := loadPackagesOverlayContext(t, overlay, nil, nil, "./...")
+
+	prog, ssaPkgs := ssautil.Packages(pkgs, mode)
+	prog.Build()
+
+	files := make(map[string]*ast.File)
+	for _, pkg := range pkgs {
+		for i, f := range pkg.Syntax {
+			rel, err := filepath.Rel(dir, pkg.CompiledGoFiles[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[filepath.ToSlash(rel)] = f
+		}
+	}
+
+	return prog, ssaPkgs, files
+}
+
+// outermostDir returns the name of the first top-level directory of fsys in
+// lexical order, or "example" if fsys has no top-level directory (e.g. its
+// Go files live at the archive root).
+func outermostDir(fsys fs.FS) string {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return "example"
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			return e.Name()
+		}
+	}
+	return "example"
+}
+
 // parsePackageClause is a test helper to extract the package name from a string
 // containing the content of a go file.
 func parsePackageClause(t testing.TB, content string) string {
@@ -143,3 +357,112 @@ func parsePackageClause(t testing.TB, content string) string {
 	}
 	return f.Name.Name
 }
+
+// TestLoadPackagesOverlay confirms that packages.Load can resolve an entire
+// module, including its go.mod, purely from Config.Overlay: buildContent
+// relies on this to load packages without ever writing to disk.
+func TestLoadPackagesOverlay(t *testing.T) {
+	overlay := map[string][]byte{
+		"go.mod": goMod("example.com/p", -1),
+		"p.go":   []byte("package p\n\nconst X = 1\n"),
+	}
+	pkgs := loadPackagesOverlay(t, overlay, "example.com/p")
+	if len(pkgs) != 1 {
+		t.Fatalf("got %d packages, want 1", len(pkgs))
+	}
+	if got, want := pkgs[0].PkgPath, "example.com/p"; got != want {
+		t.Errorf("PkgPath = %q, want %q", got, want)
+	}
+}
+
+// TestBuildContentMatrix builds a package that reads runtime.GOOS across two
+// targets and checks not just that both show up in the returned map, but
+// that the built SSA actually differs between them: runtime.GOOS is
+// constant-folded to the target's GOOS, so each function's disassembly
+// should mention its own GOOS and differ from the other target's.
+func TestBuildContentMatrix(t *testing.T) {
+	const content = `package p
+
+import "runtime"
+
+func GOOS() string { return runtime.GOOS }
+`
+	targets := []buildTarget{
+		{GOOS: "linux", GOARCH: "amd64"},
+		{GOOS: "windows", GOARCH: "amd64"},
+	}
+	pkgs := buildContentMatrix(t, content, 0, targets)
+	if len(pkgs) != len(targets) {
+		t.Fatalf("got %d ssa packages, want %d", len(pkgs), len(targets))
+	}
+
+	dumps := make(map[buildKey]string, len(targets))
+	for _, target := range targets {
+		key := newBuildKey(target)
+		pkg := pkgs[key]
+		if pkg == nil {
+			t.Fatalf("missing ssa.Package for %s/%s", target.GOOS, target.GOARCH)
+		}
+		fn := pkg.Func("GOOS")
+		if fn == nil {
+			t.Fatalf("missing function GOOS for %s/%s", target.GOOS, target.GOARCH)
+		}
+		var buf bytes.Buffer
+		fn.WriteTo(&buf)
+		dump := buf.String()
+		if !strings.Contains(dump, fmt.Sprintf("%q", target.GOOS)) {
+			t.Errorf("SSA for %s/%s does not mention %q:\n%s", target.GOOS, target.GOARCH, target.GOOS, dump)
+		}
+		dumps[key] = dump
+	}
+
+	// Comparing whole dumps would pass even on a regression to identical
+	// SSA, since each target is built in its own t.TempDir() and
+	// fn.WriteTo embeds that path in a "# Location:" comment. Instead
+	// check directly that one target's GOOS never leaks into another's
+	// disassembly.
+	for _, target := range targets {
+		dump := dumps[newBuildKey(target)]
+		for _, other := range targets {
+			if other.GOOS == target.GOOS {
+				continue
+			}
+			if strings.Contains(dump, fmt.Sprintf("%q", other.GOOS)) {
+				t.Errorf("SSA for %s/%s unexpectedly mentions %q, the other target's GOOS", target.GOOS, target.GOARCH, other.GOOS)
+			}
+		}
+	}
+}
+
+const buildTxtarExample = `
+-- go.mod --
+module example.com/m
+
+go 1.21
+-- a/main.go --
+package a
+
+const X = 1
+-- b/main.go --
+package b
+
+const Y = 2
+`
+
+// TestBuildTxtar builds a txtar archive containing two packages whose files
+// share the basename "main.go", and checks that the returned files map keys
+// them by their distinct archive-relative paths rather than colliding.
+func TestBuildTxtar(t *testing.T) {
+	_, pkgs, files := buildTxtar(t, buildTxtarExample, 0)
+	if len(pkgs) != 2 {
+		t.Fatalf("got %d ssa packages, want 2", len(pkgs))
+	}
+	for _, name := range []string{"a/main.go", "b/main.go"} {
+		if files[name] == nil {
+			t.Errorf("missing parsed file for %q", name)
+		}
+	}
+	if files["a/main.go"] == files["b/main.go"] {
+		t.Errorf("a/main.go and b/main.go resolved to the same *ast.File")
+	}
+}